@@ -3,29 +3,58 @@ package main
 import (
 	"bufio"
 	"container/heap"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"strings"
+	"sort"
 	"sync"
 )
 
-// Структура для хранения профиля белка с биграммами
+// alphaSize - размер алфавита аминокислот (A-Z), используемый при кодировании
+// k-меров в базовые-26 числа.
+const alphaSize = 26
+
+// sparseThresholdK - начиная с этого размера k-мера плотный массив
+// alphaSize^k становится слишком большим (26^5 ~ 11.9М корзин на один
+// белок), и профиль хранится в разреженном виде.
+const sparseThresholdK = 4
+
+// maxSupportedK - наибольший размер k-мера, для которого скользящий хэш в
+// forEachKmer ещё помещается в uint32 (26^maxSupportedK <= MaxUint32; уже
+// 26^7 ~ 8.03e9 это переполняет и тихо даёт коллизии ключей).
+const maxSupportedK = 6
+
+// kmerCount - счётчик одного k-мера в разреженном профиле.
+type kmerCount struct {
+	Key   uint32
+	Count uint32
+}
+
+// ProteinProfile - профиль белка: счётчики k-меров, закодированных в
+// базовые-26 числа. При малых k (Dense != nil) используется плотный массив
+// длиной alphaSize^k; при k >= sparseThresholdK (Sparse != nil) - список пар
+// (ключ, счётчик), отсортированный по ключу.
 type ProteinProfile struct {
-	Profile [676]uint32
-	Sum     uint64
+	Dense  []uint32
+	Sparse []kmerCount
+	Sum    uint64
 }
 
 // Структура для хранения результатов родственности
 type ProteinSimilarity struct {
-	similarity float64
+	similarity float64 // значение метрики в исходном масштабе (для вывода)
+	goodness   float64 // -goodness по шкале "больше - лучше" (для очереди)
 	name       string
 }
 
-// Приоритетная очередь для топ-100 родственников
+// Приоритетная очередь для топ-100 родственников. Хранит goodness со знаком
+// минус, поэтому худший по метрике элемент всегда оказывается в корне и
+// первым вытесняется при переполнении.
 type MaxHeap []ProteinSimilarity
 
 func (h MaxHeap) Len() int           { return len(h) }
-func (h MaxHeap) Less(i, j int) bool { return h[i].similarity > h[j].similarity }
+func (h MaxHeap) Less(i, j int) bool { return h[i].goodness > h[j].goodness }
 func (h MaxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
 
 func (h *MaxHeap) Push(x interface{}) {
@@ -40,36 +69,135 @@ func (h *MaxHeap) Pop() interface{} {
 	return x
 }
 
-// Построение профиля для одной последовательности с биграммами
-func buildProfile(sequence string) ProteinProfile {
-	var profile [676]uint32
+// buildProfile строит профиль белка для заданного размера k-мера. При
+// k < sparseThresholdK используется плотный массив из alphaSize^k корзин,
+// иначе - отсортированный разреженный список, чтобы не тратить память на
+// почти пустой плотный массив.
+func buildProfile(sequence string, k int) ProteinProfile {
+	if k >= sparseThresholdK {
+		return buildSparseProfile(sequence, k)
+	}
+	return buildDenseProfile(sequence, k)
+}
+
+// buildDenseProfile строит плотный профиль для небольших k.
+func buildDenseProfile(sequence string, k int) ProteinProfile {
+	size := 1
+	for i := 0; i < k; i++ {
+		size *= alphaSize
+	}
+
+	profile := make([]uint32, size)
 	var sum uint64
+	forEachKmer(sequence, k, func(key uint32) {
+		profile[key]++
+		sum++
+	})
 
-	for i := 0; i+1 < len(sequence); i++ {
-		index := (int(sequence[i]-'A') * 26) + int(sequence[i+1]-'A')
-		profile[index]++
+	return ProteinProfile{Dense: profile, Sum: sum}
+}
+
+// buildSparseProfile строит разреженный профиль для больших k: счётчики
+// копятся в карте, а затем переносятся в список, отсортированный по ключу,
+// чтобы сравнение двух профилей могло идти слиянием (как при пересечении
+// отсортированных массивов).
+func buildSparseProfile(sequence string, k int) ProteinProfile {
+	counts := make(map[uint32]uint32)
+	var sum uint64
+	forEachKmer(sequence, k, func(key uint32) {
+		counts[key]++
 		sum++
+	})
+
+	sparse := make([]kmerCount, 0, len(counts))
+	for key, count := range counts {
+		sparse = append(sparse, kmerCount{Key: key, Count: count})
 	}
+	sort.Slice(sparse, func(i, j int) bool { return sparse[i].Key < sparse[j].Key })
 
-	return ProteinProfile{profile, sum}
+	return ProteinProfile{Sparse: sparse, Sum: sum}
 }
 
-// Вычисление родственности между двумя профилями
-func calculateSimilarity(X, Y ProteinProfile) float64 {
-	sumMin := uint64(0)
-	for i := 0; i < 676; i++ {
-		if X.Profile[i] < Y.Profile[i] {
-			sumMin += uint64(X.Profile[i])
-		} else {
-			sumMin += uint64(Y.Profile[i])
+// forEachKmer вычисляет базовую-26 кодировку каждого k-мера в sequence
+// скользящим хэшем: код следующего k-мера получается из предыдущего за O(1),
+// без пересчёта с нуля, поэтому построение профиля остаётся O(len(sequence)).
+func forEachKmer(sequence string, k int, f func(key uint32)) {
+	if k <= 0 || len(sequence) < k {
+		return
+	}
+
+	highPow := uint32(1)
+	for i := 0; i < k-1; i++ {
+		highPow *= alphaSize
+	}
+
+	var code uint32
+	for i := 0; i < len(sequence); i++ {
+		c := uint32(sequence[i] - 'A')
+		if i < k {
+			code = code*alphaSize + c
+			if i == k-1 {
+				f(code)
+			}
+			continue
+		}
+		leading := uint32(sequence[i-k] - 'A')
+		code = (code-leading*highPow)*alphaSize + c
+		f(code)
+	}
+}
+
+// forEachKey обходит объединение ненулевых ключей двух профилей и вызывает f
+// со счётчиками из X и Y (0, если ключ в одном из профилей отсутствует).
+// Для пары плотных профилей это простой проход по массиву; если хотя бы один
+// профиль разреженный, используется его список ключей; для пары разреженных
+// профилей - слияние двух отсортированных списков.
+func forEachKey(X, Y *ProteinProfile, f func(x, y uint32)) {
+	switch {
+	case X.Dense != nil && Y.Dense != nil:
+		for i := range X.Dense {
+			f(X.Dense[i], Y.Dense[i])
+		}
+	case X.Dense != nil && Y.Dense == nil:
+		seen := make(map[uint32]bool, len(Y.Sparse))
+		for _, kv := range Y.Sparse {
+			f(X.Dense[kv.Key], kv.Count)
+			seen[kv.Key] = true
+		}
+		for key, count := range X.Dense {
+			if count > 0 && !seen[uint32(key)] {
+				f(count, 0)
+			}
+		}
+	case X.Dense == nil && Y.Dense != nil:
+		forEachKey(Y, X, func(y, x uint32) { f(x, y) })
+	default:
+		i, j := 0, 0
+		for i < len(X.Sparse) && j < len(Y.Sparse) {
+			switch {
+			case X.Sparse[i].Key == Y.Sparse[j].Key:
+				f(X.Sparse[i].Count, Y.Sparse[j].Count)
+				i++
+				j++
+			case X.Sparse[i].Key < Y.Sparse[j].Key:
+				f(X.Sparse[i].Count, 0)
+				i++
+			default:
+				f(0, Y.Sparse[j].Count)
+				j++
+			}
+		}
+		for ; i < len(X.Sparse); i++ {
+			f(X.Sparse[i].Count, 0)
+		}
+		for ; j < len(Y.Sparse); j++ {
+			f(0, Y.Sparse[j].Count)
 		}
 	}
-	sumMax := X.Sum + Y.Sum - sumMin
-	return float64(sumMin) / float64(sumMax)
 }
 
 // Построение профилей параллельно с ограничением горутин
-func buildProfilesParallel(sequences []string, maxGoroutines int, startIndex int) []ProteinProfile {
+func buildProfilesParallel(sequences []string, maxGoroutines int, startIndex int, k int) []ProteinProfile {
 	profiles := make([]ProteinProfile, len(sequences))
 	var wg sync.WaitGroup
 	semaphore := make(chan struct{}, maxGoroutines)
@@ -79,7 +207,7 @@ func buildProfilesParallel(sequences []string, maxGoroutines int, startIndex int
 		semaphore <- struct{}{}
 		go func(index int, sequence string) {
 			defer wg.Done()
-			profile := buildProfile(sequence)
+			profile := buildProfile(sequence, k)
 			profiles[index] = profile
 			<-semaphore
 		}(i, seq)
@@ -89,15 +217,21 @@ func buildProfilesParallel(sequences []string, maxGoroutines int, startIndex int
 	return profiles
 }
 
-// Поиск топ-100 родственников с логированием индексов
-func findTop100Similar(newProteinSequence string, profiles []ProteinProfile, names []string, topN int) []ProteinSimilarity {
-	newProfile := buildProfile(newProteinSequence)
+// Поиск топ-N родственников по выбранной метрике. Метрика может быть как
+// мерой сходства (больше - лучше), так и мерой различия (меньше - лучше) -
+// порядок очереди определяется полем MetricSpec.HigherIsBetter.
+func findTop100Similar(newProteinSequence string, profiles []ProteinProfile, names []string, topN int, k int, metric MetricSpec) []ProteinSimilarity {
+	newProfile := buildProfile(newProteinSequence, k)
 	var minHeap MaxHeap
 	heap.Init(&minHeap)
 
 	for i, profile := range profiles {
-		similarity := calculateSimilarity(newProfile, profile)
-		heap.Push(&minHeap, ProteinSimilarity{-similarity, names[i]})
+		value := metric.Func(newProfile, profile)
+		goodness := value
+		if !metric.HigherIsBetter {
+			goodness = -value
+		}
+		heap.Push(&minHeap, ProteinSimilarity{similarity: value, goodness: -goodness, name: names[i]})
 		if minHeap.Len() > topN {
 			heap.Pop(&minHeap)
 		}
@@ -106,70 +240,71 @@ func findTop100Similar(newProteinSequence string, profiles []ProteinProfile, nam
 	var result []ProteinSimilarity
 	for minHeap.Len() > 0 {
 		item := heap.Pop(&minHeap).(ProteinSimilarity)
-		item.similarity = -item.similarity
 		result = append(result, item)
 	}
 
 	return result
 }
 
-// Обработка файла по частям
-func processFileInChunks(filename string, chunkSize int, maxGoroutines int) ([]string, []ProteinProfile, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, nil, fmt.Errorf("ошибка открытия файла: %v", err)
-	}
-	defer file.Close()
-
-	var allNames []string
-	var allProfiles []ProteinProfile
-	scanner := bufio.NewScanner(file)
-	var currentChunkNames []string
-	var currentChunkSequences []string
-	var currentName string
-	var currentSequence strings.Builder
-	var lineCount int
-	var totalProcessed int // Общее количество обработанных белков
-
-	for scanner.Scan() {
-		lineCount++
-		line := scanner.Text()
-		if strings.HasPrefix(line, ">") {
-			if currentName != "" {
-				currentChunkNames = append(currentChunkNames, currentName)
-				currentChunkSequences = append(currentChunkSequences, currentSequence.String())
-				currentSequence.Reset()
-			}
-			currentName = line
-		} else {
-			currentSequence.WriteString(line)
-		}
-
-		if len(currentChunkSequences) >= chunkSize {
-			profiles := buildProfilesParallel(currentChunkSequences, maxGoroutines, totalProcessed)
-			allNames = append(allNames, currentChunkNames...)
-			allProfiles = append(allProfiles, profiles...)
-			totalProcessed += len(currentChunkSequences)
-			currentChunkNames = nil
-			currentChunkSequences = nil
-		}
+func main() {
+	metricName := flag.String("metric", "tanimoto", "метрика родственности: tanimoto, cosine, euclidean или kl")
+	k := flag.Int("k", 2, "размер k-мера (при k>=4 профиль хранится разреженно)")
+	treePath := flag.String("tree", "", "файл для UPGMA-дерева топ-N родственников в формате Newick (пусто - не строить)")
+	formatName := flag.String("format", "text", "формат вывода: text, tsv, csv, json или fasta")
+	fastaPath := flag.String("fasta", "", "FASTA-файл для пополнения базы данных новыми последовательностями (применяется только при явном указании флага - запросы к уже наполненной базе его не требуют)")
+	serveAddr := flag.String("serve", "", "запустить HTTP-сервер на указанном адресе (например :8080) вместо интерактивного режима")
+	flag.Parse()
+
+	metric, ok := metrics[*metricName]
+	if !ok {
+		fmt.Printf("Неизвестная метрика: %s\n", *metricName)
+		return
+	}
+	if *k <= 0 || *k > maxSupportedK {
+		fmt.Printf("Размер k-мера должен быть в диапазоне 1..%d (больший код k-мера не помещается в uint32): %d\n", maxSupportedK, *k)
+		return
+	}
+	if !outputFormats[*formatName] {
+		fmt.Printf("Неизвестный формат вывода: %s\n", *formatName)
+		return
 	}
 
-	if currentName != "" {
-		currentChunkNames = append(currentChunkNames, currentName)
-		currentChunkSequences = append(currentChunkSequences, currentSequence.String())
+	// Загружаем персистентную базу профилей (если она уже существует)
+	db, err := OpenDB("profiles.gob", *k)
+	if err != nil {
+		fmt.Printf("Не удалось открыть базу данных профилей: %v\n", err)
+		return
 	}
 
-	if len(currentChunkSequences) > 0 {
-		profiles := buildProfilesParallel(currentChunkSequences, maxGoroutines, totalProcessed)
-		allNames = append(allNames, currentChunkNames...)
-		allProfiles = append(allProfiles, profiles...)
+	// Пополняем базу данных новыми последовательностями, только если
+	// пользователь явно указал файл через -fasta. Иначе база просто
+	// загружается такой, какая она есть на диске - повторные запросы не
+	// требуют заново разбирать FASTA и не плодят дубликаты в profiles.gob.
+	filename := *fastaPath
+	if filename == "" && *serveAddr == "" && len(db.Names) == 0 {
+		// База ещё пуста и флаг не указан - запрашиваем файл для
+		// первоначального наполнения в интерактивном режиме.
+		fmt.Print("База данных пуста. Введите название файла с данными: ")
+		fmt.Scanln(&filename)
+	}
+	if filename != "" {
+		if err := db.AppendFasta(filename); err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+		if err := db.Close(); err != nil {
+			fmt.Printf("Не удалось сохранить базу данных профилей: %v\n", err)
+			return
+		}
 	}
 
-	return allNames, allProfiles, scanner.Err()
-}
+	if *serveAddr != "" {
+		if err := runServer(*serveAddr, db, *k); err != nil {
+			fmt.Printf("Ошибка сервера: %v\n", err)
+		}
+		return
+	}
 
-func main() {
 	// Создаём файл для вывода результатов
 	outputFile, err := os.Create("output.txt")
 	if err != nil {
@@ -180,13 +315,11 @@ func main() {
 	}
 	defer outputFile.Close()
 
-	// Запрашиваем у пользователя название файла
-	var filename string
-	fmt.Print("Введите название файла с данными: ")
-	fmt.Scanln(&filename)
-
-	// Обрабатываем файл по частям, с ограничением горутин
-	names, profiles, err := processFileInChunks(filename, 10000, 6)
+	names, profiles := db.Names, db.Profiles
+	nameToSequence := make(map[string]string, len(db.Names))
+	for i, name := range db.Names {
+		nameToSequence[name] = db.Sequences[i]
+	}
 
 	fmt.Printf("Успешно прочитано %d белков.\n", len(names))
 	outputFile.WriteString(fmt.Sprintf("Успешно прочитано %d белков.\n", len(names)))
@@ -203,15 +336,47 @@ func main() {
 	//newProteinSequence := "MALWMRLLPLLALLALWGPDPAAAFVNQHLCGSHLVEALYLVCGERGFFYTPKTRREAEDLQVGQVELGGGPGAGSLQPLALEGSLQKRGIVEQCCTSICSLYQLENYCN"
 
 	topN := 100
-	topSimilarities := findTop100Similar(newProteinSequence, profiles, names, topN)
+	topSimilarities := findTop100Similar(newProteinSequence, profiles, names, topN, *k, metric)
 
-	// Выводим топ-100 родственников в файл
-	outputFile.WriteString(fmt.Sprintf("Toп %d родственников:\n", topN))
+	// Выводим топ-N родственников в выбранном формате, одновременно в файл
+	// и на экран
+	format, err := newOutputFormat(*formatName, *metricName, nameToSequence)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	out := io.MultiWriter(outputFile, os.Stdout)
+	if err := format.Head(out, newProteinSequence); err != nil {
+		fmt.Printf("Ошибка вывода результатов: %v\n", err)
+		return
+	}
 	for i := len(topSimilarities) - 1; i >= 0; i-- {
-		line := fmt.Sprintf("%d. %s (родственность: %.4f)\n", len(topSimilarities)-i, topSimilarities[i].name, topSimilarities[i].similarity)
-		outputFile.WriteString(line)
-		fmt.Print(line)
+		rank := len(topSimilarities) - i
+		if err := format.Row(out, rank, topSimilarities[i]); err != nil {
+			fmt.Printf("Ошибка вывода результатов: %v\n", err)
+			return
+		}
+	}
+	if err := format.Finish(out); err != nil {
+		fmt.Printf("Ошибка вывода результатов: %v\n", err)
+		return
 	}
 
 	fmt.Println("Результаты записаны в файл output.txt")
+
+	// При указанном -tree дополнительно строим UPGMA-дерево топ-N
+	// родственников вместе с запросом и сохраняем его в формате Newick
+	if *treePath != "" {
+		nameToProfile := make(map[string]ProteinProfile, len(names))
+		for i, name := range names {
+			nameToProfile[name] = profiles[i]
+		}
+		queryProfile := buildProfile(newProteinSequence, *k)
+		newick := clusterTopHits(queryProfile, topSimilarities, nameToProfile, metric)
+		if err := os.WriteFile(*treePath, []byte(newick+"\n"), 0644); err != nil {
+			fmt.Printf("Не удалось сохранить дерево: %v\n", err)
+		} else {
+			fmt.Printf("Дерево сохранено в файл %s\n", *treePath)
+		}
+	}
 }
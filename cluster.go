@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// upgmaNode - узел дерева UPGMA: либо лист (Label != "", Left == Right == nil),
+// либо внутренний узел, объединяющий два поддерева с заданной длиной ветвей.
+type upgmaNode struct {
+	label             string
+	height            float64
+	size              int
+	left, right       *upgmaNode
+	leftLen, rightLen float64
+}
+
+// newick сериализует поддерево в формате Newick (без завершающей точки с
+// запятой - её добавляет вызывающий код для корня).
+func (n *upgmaNode) newick() string {
+	if n.left == nil && n.right == nil {
+		return n.label
+	}
+	return fmt.Sprintf("(%s:%.4f,%s:%.4f)", n.left.newick(), n.leftLen, n.right.newick(), n.rightLen)
+}
+
+// upgmaTree строит дерево методом UPGMA по матрице расстояний: на каждом шаге
+// объединяются два ближайших кластера в новый узел с высотой d(i,j)/2, а
+// расстояние от нового кластера до каждого оставшегося k пересчитывается как
+// взвешенное по размеру среднее (|i|*d(i,k)+|j|*d(j,k))/(|i|+|j|).
+func upgmaTree(labels []string, dist [][]float64) *upgmaNode {
+	nodes := make([]*upgmaNode, len(labels))
+	for i, label := range labels {
+		nodes[i] = &upgmaNode{label: label, size: 1}
+	}
+	matrix := dist
+
+	for len(nodes) > 1 {
+		bi, bj := 0, 1
+		best := math.Inf(1)
+		for i := range nodes {
+			for j := i + 1; j < len(nodes); j++ {
+				if matrix[i][j] < best {
+					best = matrix[i][j]
+					bi, bj = i, j
+				}
+			}
+		}
+
+		ni, nj := nodes[bi], nodes[bj]
+		height := best / 2
+		merged := &upgmaNode{
+			left:     ni,
+			right:    nj,
+			leftLen:  height - ni.height,
+			rightLen: height - nj.height,
+			height:   height,
+			size:     ni.size + nj.size,
+		}
+
+		var keep []int
+		for k := range nodes {
+			if k != bi && k != bj {
+				keep = append(keep, k)
+			}
+		}
+
+		newNodes := make([]*upgmaNode, 0, len(keep)+1)
+		newNodes = append(newNodes, merged)
+		for _, k := range keep {
+			newNodes = append(newNodes, nodes[k])
+		}
+
+		newMatrix := make([][]float64, len(newNodes))
+		for i := range newMatrix {
+			newMatrix[i] = make([]float64, len(newNodes))
+		}
+		for a, ka := range keep {
+			for b, kb := range keep {
+				newMatrix[a+1][b+1] = matrix[ka][kb]
+			}
+		}
+		for a, ka := range keep {
+			d := (float64(ni.size)*matrix[bi][ka] + float64(nj.size)*matrix[bj][ka]) / float64(merged.size)
+			newMatrix[0][a+1] = d
+			newMatrix[a+1][0] = d
+		}
+
+		nodes = newNodes
+		matrix = newMatrix
+	}
+
+	return nodes[0]
+}
+
+// similarityToDistance переводит значение метрики в расстояние для
+// кластеризации: для мер сходства d=1-s, а для мер различия (например,
+// KL-дивергенции) значение уже является расстоянием.
+func similarityToDistance(value float64, metric MetricSpec) float64 {
+	if metric.HigherIsBetter {
+		return 1 - value
+	}
+	return value
+}
+
+// sanitizeNewickLabel заменяет символы, запрещённые в формате Newick
+// ( ) [ ] : ; , и пробел, на подчёркивание, чтобы заголовок FASTA-записи
+// можно было использовать как метку листа.
+func sanitizeNewickLabel(label string) string {
+	replacer := strings.NewReplacer(
+		"(", "_", ")", "_", "[", "_", "]", "_",
+		":", "_", ";", "_", ",", "_", " ", "_",
+	)
+	return replacer.Replace(label)
+}
+
+// clusterTopHits строит UPGMA-дерево по запросу и его топ-N родственникам и
+// возвращает результат в формате Newick, чтобы можно было визуализировать
+// локальное окружение запроса. Профили родственников берутся из
+// nameToProfile; записи, для которых профиль не найден, пропускаются.
+func clusterTopHits(queryProfile ProteinProfile, hits []ProteinSimilarity, nameToProfile map[string]ProteinProfile, metric MetricSpec) string {
+	labels := []string{"query"}
+	profiles := []ProteinProfile{queryProfile}
+
+	for _, hit := range hits {
+		profile, ok := nameToProfile[hit.name]
+		if !ok {
+			continue
+		}
+		labels = append(labels, sanitizeNewickLabel(hit.name))
+		profiles = append(profiles, profile)
+	}
+
+	n := len(labels)
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			d := similarityToDistance(metric.Func(profiles[i], profiles[j]), metric)
+			dist[i][j] = d
+			dist[j][i] = d
+		}
+	}
+
+	return upgmaTree(labels, dist).newick() + ";"
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Магическая сигнатура и версия формата базы данных профилей
+const (
+	dbMagic = "PPDB"
+	// dbVersion повышается при любом изменении формата dbPayload, чтобы
+	// OpenDB отклонял файлы, записанные старым форматом, вместо того чтобы
+	// декодировать их с недостающими полями (см. добавление Sequences).
+	dbVersion = 2
+)
+
+// Заголовок файла базы данных: позволяет отклонить несовместимые базы,
+// не распаковывая их целиком
+type dbHeader struct {
+	Magic      [4]byte
+	Version    uint32
+	KSize      uint32
+	AlphaSize  uint32
+	EntryCount uint32
+	CRC        uint32
+}
+
+// dbPayload - содержимое базы данных, сериализуемое через gob
+type dbPayload struct {
+	Names     []string
+	Sequences []string
+	Profiles  []ProteinProfile
+}
+
+// ProteinDB - персистентный индекс профилей белков на диске.
+// Позволяет один раз разобрать FASTA-файл, сохранить результат и в дальнейшем
+// дополнять индекс новыми последовательностями без повторного разбора старых.
+type ProteinDB struct {
+	path      string
+	kSize     int
+	alphaSize int
+	Names     []string
+	Sequences []string
+	Profiles  []ProteinProfile
+}
+
+// OpenDB открывает базу данных по указанному пути для заданного размера
+// k-мера. Если файла ещё нет, возвращается пустая база, готовая к заполнению
+// через AppendFasta. Если файл существует, но был построен для другого k,
+// возвращается ошибка - смешивать профили с разным k нельзя.
+func OpenDB(path string, k int) (*ProteinDB, error) {
+	db := &ProteinDB{path: path, kSize: k, alphaSize: alphaSize}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия базы данных: %v", err)
+	}
+	defer file.Close()
+
+	var header dbHeader
+	if err := binary.Read(file, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("ошибка чтения заголовка базы данных: %v", err)
+	}
+	if string(header.Magic[:]) != dbMagic {
+		return nil, fmt.Errorf("файл %s не является базой данных профилей", path)
+	}
+	if header.Version != dbVersion {
+		return nil, fmt.Errorf("неподдерживаемая версия базы данных: %d", header.Version)
+	}
+	if int(header.KSize) != db.kSize || int(header.AlphaSize) != db.alphaSize {
+		return nil, fmt.Errorf("несовместимые параметры базы данных: k=%d, алфавит=%d (ожидалось k=%d, алфавит=%d)",
+			header.KSize, header.AlphaSize, db.kSize, db.alphaSize)
+	}
+
+	body, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения тела базы данных: %v", err)
+	}
+	if crc32.ChecksumIEEE(body) != header.CRC {
+		return nil, fmt.Errorf("база данных повреждена: контрольная сумма не совпадает")
+	}
+
+	var payload dbPayload
+	if err := gob.NewDecoder(bytes.NewReader(body)).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования базы данных: %v", err)
+	}
+	if uint32(len(payload.Names)) != header.EntryCount {
+		return nil, fmt.Errorf("база данных повреждена: несоответствие количества записей")
+	}
+	if len(payload.Sequences) != len(payload.Names) {
+		return nil, fmt.Errorf("база данных повреждена: количество последовательностей (%d) не совпадает с количеством имён (%d)",
+			len(payload.Sequences), len(payload.Names))
+	}
+
+	db.Names = payload.Names
+	db.Sequences = payload.Sequences
+	db.Profiles = payload.Profiles
+	return db, nil
+}
+
+// AppendFasta разбирает дополнительный FASTA-файл и добавляет новые профили
+// к уже загруженным, не трогая существующие записи.
+func (db *ProteinDB) AppendFasta(path string) error {
+	names, sequences, profiles, err := processFasta(path, db.kSize)
+	if err != nil {
+		return fmt.Errorf("ошибка добавления %s в базу данных: %v", path, err)
+	}
+	db.Names = append(db.Names, names...)
+	db.Sequences = append(db.Sequences, sequences...)
+	db.Profiles = append(db.Profiles, profiles...)
+	return nil
+}
+
+// Close сохраняет текущее содержимое базы данных на диск по пути, с которым
+// она была открыта.
+func (db *ProteinDB) Close() error {
+	var body bytes.Buffer
+	payload := dbPayload{Names: db.Names, Sequences: db.Sequences, Profiles: db.Profiles}
+	if err := gob.NewEncoder(&body).Encode(&payload); err != nil {
+		return fmt.Errorf("ошибка кодирования базы данных: %v", err)
+	}
+
+	header := dbHeader{
+		Version:    dbVersion,
+		KSize:      uint32(db.kSize),
+		AlphaSize:  uint32(db.alphaSize),
+		EntryCount: uint32(len(db.Names)),
+		CRC:        crc32.ChecksumIEEE(body.Bytes()),
+	}
+	copy(header.Magic[:], dbMagic)
+
+	file, err := os.Create(db.path)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла базы данных: %v", err)
+	}
+	defer file.Close()
+
+	if err := binary.Write(file, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("ошибка записи заголовка базы данных: %v", err)
+	}
+	if _, err := file.Write(body.Bytes()); err != nil {
+		return fmt.Errorf("ошибка записи тела базы данных: %v", err)
+	}
+	return nil
+}
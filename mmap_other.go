@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// mmapFile на платформах без syscall.Mmap читает файл целиком в память, что
+// сохраняет общий интерфейс обработки ценой настоящего отображения памяти.
+func mmapFile(filename string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения файла: %v", err)
+	}
+	return data, func() error { return nil }, nil
+}
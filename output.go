@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// OutputFormat управляет тем, как выводится ранжированный список
+// родственников: от человекочитаемого текста до машиночитаемых TSV/CSV/JSON
+// и самих FASTA-записей найденных совпадений.
+type OutputFormat interface {
+	Head(w io.Writer, query string) error
+	Row(w io.Writer, rank int, s ProteinSimilarity) error
+	Finish(w io.Writer) error
+}
+
+// outputFormats - реестр форматов вывода, выбираемых по имени через
+// CLI-флаг -format.
+var outputFormats = map[string]bool{
+	"text": true, "tsv": true, "csv": true, "json": true, "fasta": true,
+}
+
+// newOutputFormat создаёт формат вывода по имени. nameToSequence нужен
+// только формату fasta, чтобы найти исходную последовательность по
+// заголовку; metricName подписывает значение метрики в json.
+func newOutputFormat(name, metricName string, nameToSequence map[string]string) (OutputFormat, error) {
+	switch name {
+	case "text":
+		return &textFormat{}, nil
+	case "tsv":
+		return &tsvFormat{}, nil
+	case "csv":
+		return &csvFormat{}, nil
+	case "json":
+		return &jsonFormat{metricName: metricName}, nil
+	case "fasta":
+		return &fastaFormat{nameToSequence: nameToSequence}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный формат вывода: %s", name)
+	}
+}
+
+// textFormat - исходный человекочитаемый формат вывода.
+type textFormat struct{}
+
+func (textFormat) Head(w io.Writer, query string) error {
+	_, err := fmt.Fprintln(w, "Топ родственников:")
+	return err
+}
+
+func (textFormat) Row(w io.Writer, rank int, s ProteinSimilarity) error {
+	_, err := fmt.Fprintf(w, "%d. %s (родственность: %.4f)\n", rank, s.name, s.similarity)
+	return err
+}
+
+func (textFormat) Finish(io.Writer) error { return nil }
+
+// tsvFormat - значения, разделённые табуляцией, для загрузки в электронные
+// таблицы или дальнейшей обработки в конвейере.
+type tsvFormat struct{}
+
+func (tsvFormat) Head(w io.Writer, query string) error {
+	_, err := fmt.Fprintln(w, "rank\tname\tsimilarity")
+	return err
+}
+
+func (tsvFormat) Row(w io.Writer, rank int, s ProteinSimilarity) error {
+	_, err := fmt.Fprintf(w, "%d\t%s\t%.6f\n", rank, s.name, s.similarity)
+	return err
+}
+
+func (tsvFormat) Finish(io.Writer) error { return nil }
+
+// csvFormat использует encoding/csv, поэтому значения, содержащие запятые
+// или кавычки, экранируются корректно.
+type csvFormat struct {
+	writer *csv.Writer
+}
+
+func (f *csvFormat) Head(w io.Writer, query string) error {
+	f.writer = csv.NewWriter(w)
+	return f.writer.Write([]string{"rank", "name", "similarity"})
+}
+
+func (f *csvFormat) Row(w io.Writer, rank int, s ProteinSimilarity) error {
+	return f.writer.Write([]string{
+		strconv.Itoa(rank),
+		s.name,
+		strconv.FormatFloat(s.similarity, 'f', 6, 64),
+	})
+}
+
+func (f *csvFormat) Finish(w io.Writer) error {
+	f.writer.Flush()
+	return f.writer.Error()
+}
+
+// jsonHit - одна запись потокового JSON-массива результатов.
+type jsonHit struct {
+	Rank       int     `json:"rank"`
+	Name       string  `json:"name"`
+	Similarity float64 `json:"similarity"`
+	Metric     string  `json:"metric"`
+}
+
+// jsonFormat выводит результаты в виде потокового JSON-массива объектов, не
+// накапливая их в памяти целиком.
+type jsonFormat struct {
+	metricName string
+	wroteFirst bool
+}
+
+func (f *jsonFormat) Head(w io.Writer, query string) error {
+	_, err := fmt.Fprint(w, "[")
+	return err
+}
+
+func (f *jsonFormat) Row(w io.Writer, rank int, s ProteinSimilarity) error {
+	if f.wroteFirst {
+		if _, err := fmt.Fprint(w, ","); err != nil {
+			return err
+		}
+	}
+	f.wroteFirst = true
+
+	data, err := json.Marshal(jsonHit{Rank: rank, Name: s.name, Similarity: s.similarity, Metric: f.metricName})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (f *jsonFormat) Finish(w io.Writer) error {
+	_, err := fmt.Fprintln(w, "]")
+	return err
+}
+
+// fastaFormat выдаёт исходные FASTA-записи найденных совпадений с их
+// оригинальными заголовками, беря последовательности из базы данных.
+type fastaFormat struct {
+	nameToSequence map[string]string
+}
+
+func (fastaFormat) Head(io.Writer, string) error { return nil }
+
+func (f *fastaFormat) Row(w io.Writer, rank int, s ProteinSimilarity) error {
+	sequence, ok := f.nameToSequence[s.name]
+	if !ok {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "%s\n%s\n", s.name, sequence)
+	return err
+}
+
+func (fastaFormat) Finish(io.Writer) error { return nil }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// processFasta разбирает FASTA-файл целиком через отображение в память
+// (см. mmapFile) и строит профили белков. Файл делится на GOMAXPROCS
+// примерно равных по размеру диапазонов байт, каждый из которых независимый
+// воркер сканирует от первой границы записи до следующей, разбирая записи
+// напрямую по срезам байт - без bufio.Scanner и strings.Builder. Это заменяет
+// прежнюю построчную обработку с произвольным размером чанка, рассчитанную
+// на файлы, которые не помещаются целиком в память построчно.
+func processFasta(filename string, k int) ([]string, []string, []ProteinProfile, error) {
+	data, closeMmap, err := mmapFile(filename)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("ошибка отображения файла %s в память: %v", filename, err)
+	}
+	defer closeMmap()
+
+	if len(data) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	numShards := runtime.GOMAXPROCS(0)
+	if numShards < 1 {
+		numShards = 1
+	}
+	if numShards > len(data) {
+		numShards = 1
+	}
+
+	boundaries := make([]int, numShards+1)
+	boundaries[numShards] = len(data)
+	for i := 1; i < numShards; i++ {
+		nominal := i * len(data) / numShards
+		boundaries[i] = nextRecordStart(data, nominal)
+	}
+
+	shardNames := make([][]string, numShards)
+	shardSequences := make([][]string, numShards)
+	var wg sync.WaitGroup
+	for s := 0; s < numShards; s++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			shardNames[idx], shardSequences[idx] = parseShard(data[boundaries[idx]:boundaries[idx+1]])
+		}(s)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, names := range shardNames {
+		total += len(names)
+	}
+	allNames := make([]string, 0, total)
+	allSequences := make([]string, 0, total)
+	for s := 0; s < numShards; s++ {
+		allNames = append(allNames, shardNames[s]...)
+		allSequences = append(allSequences, shardSequences[s]...)
+	}
+
+	allProfiles := buildProfilesParallel(allSequences, numShards, 0, k)
+	return allNames, allSequences, allProfiles, nil
+}
+
+// nextRecordStart возвращает индекс первого байта '>', начинающего
+// FASTA-запись (т.е. стоящего в начале файла или сразу после '\n'), на
+// позиции from или позже. Используется, чтобы выровнять границы шардов по
+// границам записей, не разрезая ни одну из них пополам.
+func nextRecordStart(data []byte, from int) int {
+	if from < 0 {
+		from = 0
+	}
+	if from >= len(data) {
+		return len(data)
+	}
+	if data[from] == '>' && (from == 0 || data[from-1] == '\n') {
+		return from
+	}
+	idx := bytes.Index(data[from:], []byte("\n>"))
+	if idx < 0 {
+		return len(data)
+	}
+	return from + idx + 1
+}
+
+// parseShard разбирает один диапазон отображённого файла, который уже
+// выровнен по границам FASTA-записей, и возвращает имена и
+// последовательности найденных в нём записей.
+func parseShard(shard []byte) ([]string, []string) {
+	var names []string
+	var sequences []string
+
+	i := 0
+	n := len(shard)
+	for i < n {
+		lineEnd := bytes.IndexByte(shard[i:], '\n')
+		var header []byte
+		if lineEnd < 0 {
+			header = shard[i:]
+			i = n
+		} else {
+			header = shard[i : i+lineEnd]
+			i += lineEnd + 1
+		}
+
+		seqStart := i
+		next := bytes.Index(shard[i:], []byte("\n>"))
+		var seqBytes []byte
+		if next < 0 {
+			seqBytes = shard[seqStart:]
+			i = n
+		} else {
+			seqBytes = shard[seqStart : seqStart+next]
+			i = seqStart + next + 1
+		}
+
+		header = bytes.TrimRight(header, "\r")
+		seqBytes = bytes.ReplaceAll(seqBytes, []byte("\r"), nil)
+		seqBytes = bytes.ReplaceAll(seqBytes, []byte("\n"), nil)
+
+		names = append(names, string(header))
+		sequences = append(sequences, string(seqBytes))
+	}
+
+	return names, sequences
+}
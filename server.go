@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	_ "net/http/pprof"
+	"time"
+)
+
+// queryServer хранит индекс профилей, загруженный один раз при старте, и
+// обслуживает запросы из памяти - в отличие от интерактивного режима,
+// который строит индекс заново при каждом запуске.
+type queryServer struct {
+	db        *ProteinDB
+	k         int
+	startedAt time.Time
+}
+
+// similarRequest - тело запроса POST /similar.
+type similarRequest struct {
+	Sequence string `json:"sequence"`
+	TopN     int    `json:"topN"`
+	Metric   string `json:"metric"`
+}
+
+// similarHit - одна строка ответа POST /similar, упорядоченного от лучшего
+// совпадения к худшему.
+type similarHit struct {
+	Rank       int     `json:"rank"`
+	Name       string  `json:"name"`
+	Similarity float64 `json:"similarity"`
+}
+
+// runServer поднимает HTTP-сервер на addr поверх уже загруженной базы данных
+// db. Построение профилей для полного SwissProt занимает минуты, но при
+// таком режиме это делается один раз при старте, а каждый последующий
+// запрос обрабатывается за миллисекунды.
+func runServer(addr string, db *ProteinDB, k int) error {
+	srv := &queryServer{db: db, k: k, startedAt: time.Now()}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/similar", srv.handleSimilar)
+	mux.HandleFunc("/healthz", srv.handleHealthz)
+	mux.HandleFunc("/stats", srv.handleStats)
+	mux.Handle("/debug/pprof/", http.DefaultServeMux)
+
+	fmt.Printf("Сервер запущен на %s (белков в индексе: %d)\n", addr, len(db.Names))
+	return http.ListenAndServe(addr, mux)
+}
+
+// handleSimilar обрабатывает POST /similar: принимает последовательность,
+// желаемое количество результатов и метрику, возвращает ранжированный
+// список родственников в формате JSON.
+func (s *queryServer) handleSimilar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "поддерживается только POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req similarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("некорректное тело запроса: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Sequence == "" {
+		http.Error(w, "поле sequence обязательно", http.StatusBadRequest)
+		return
+	}
+
+	topN := req.TopN
+	if topN <= 0 {
+		topN = 100
+	}
+	metricName := req.Metric
+	if metricName == "" {
+		metricName = "tanimoto"
+	}
+	metric, ok := metrics[metricName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("неизвестная метрика: %s", metricName), http.StatusBadRequest)
+		return
+	}
+
+	hits := findTop100Similar(req.Sequence, s.db.Profiles, s.db.Names, topN, s.k, metric)
+
+	response := make([]similarHit, len(hits))
+	for i, hit := range hits {
+		rank := len(hits) - i
+		response[rank-1] = similarHit{Rank: rank, Name: hit.name, Similarity: hit.similarity}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleHealthz обслуживает GET /healthz для проверок живости.
+func (s *queryServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// statsResponse - тело ответа GET /stats.
+type statsResponse struct {
+	Entries       int     `json:"entries"`
+	KSize         int     `json:"kSize"`
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+}
+
+// handleStats обслуживает GET /stats: размер индекса и время работы сервера.
+func (s *queryServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statsResponse{
+		Entries:       len(s.db.Names),
+		KSize:         s.k,
+		UptimeSeconds: time.Since(s.startedAt).Seconds(),
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import "math"
+
+// SimilarityFunc вычисляет степень родственности (или различия, в зависимости
+// от метрики) между двумя профилями белков.
+type SimilarityFunc func(X, Y ProteinProfile) float64
+
+// MetricSpec описывает одну метрику: саму функцию и то, как упорядочены её
+// значения - для KL-дивергенции меньшее значение означает большую
+// родственность, в отличие от остальных метрик.
+type MetricSpec struct {
+	Func           SimilarityFunc
+	HigherIsBetter bool
+}
+
+// metrics - реестр доступных метрик родственности, выбираемых по имени
+// через CLI-флаг -metric.
+var metrics = map[string]MetricSpec{
+	"tanimoto":  {Func: tanimotoSimilarity, HigherIsBetter: true},
+	"cosine":    {Func: cosineSimilarity, HigherIsBetter: true},
+	"euclidean": {Func: euclideanSimilarity, HigherIsBetter: true},
+	"kl":        {Func: symmetricKLDivergence, HigherIsBetter: false},
+}
+
+// tanimotoSimilarity - взвешенный коэффициент Жаккара (min/max) по счётчикам
+// k-меров. Это исходная метрика родственности, использовавшаяся в программе.
+func tanimotoSimilarity(X, Y ProteinProfile) float64 {
+	var sumMin uint64
+	forEachKey(&X, &Y, func(x, y uint32) {
+		if x < y {
+			sumMin += uint64(x)
+		} else {
+			sumMin += uint64(y)
+		}
+	})
+
+	sumMax := X.Sum + Y.Sum - sumMin
+	if sumMax == 0 {
+		return 0
+	}
+	return float64(sumMin) / float64(sumMax)
+}
+
+// cosineSimilarity - косинус угла между векторами счётчиков k-меров.
+func cosineSimilarity(X, Y ProteinProfile) float64 {
+	var dot, normX, normY float64
+	forEachKey(&X, &Y, func(x, y uint32) {
+		fx, fy := float64(x), float64(y)
+		dot += fx * fy
+		normX += fx * fx
+		normY += fy * fy
+	})
+
+	denom := math.Sqrt(normX) * math.Sqrt(normY)
+	if denom == 0 {
+		return 0
+	}
+	return dot / denom
+}
+
+// euclideanSimilarity - евклидово расстояние между векторами счётчиков
+// k-меров, преобразованное в родственность по формуле 1/(1+d), чтобы, как и
+// у остальных метрик, большие значения означали большее сходство.
+func euclideanSimilarity(X, Y ProteinProfile) float64 {
+	var sumSq float64
+	forEachKey(&X, &Y, func(x, y uint32) {
+		diff := float64(x) - float64(y)
+		sumSq += diff * diff
+	})
+	return 1 / (1 + math.Sqrt(sumSq))
+}
+
+// symmetricKLDivergence - симметричная дивергенция Кульбака-Лейблера между
+// нормализованными частотными векторами, 0.5*(KL(p||m)+KL(q||m)) с
+// m=(p+q)/2, что позволяет избежать деления на ноль. Это мера различия, а не
+// родственности: меньшее значение означает более похожие профили.
+func symmetricKLDivergence(X, Y ProteinProfile) float64 {
+	if X.Sum == 0 || Y.Sum == 0 {
+		return math.Inf(1)
+	}
+
+	var klP, klQ float64
+	forEachKey(&X, &Y, func(x, y uint32) {
+		p := float64(x) / float64(X.Sum)
+		q := float64(y) / float64(Y.Sum)
+		m := (p + q) / 2
+		if m == 0 {
+			return
+		}
+		if p > 0 {
+			klP += p * math.Log(p/m)
+		}
+		if q > 0 {
+			klQ += q * math.Log(q/m)
+		}
+	})
+	return 0.5 * (klP + klQ)
+}